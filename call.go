@@ -0,0 +1,33 @@
+package go_trans
+
+// TransMessage carries the raw output produced by a transcoding plugin, such
+// as the printed information on success or the failure reason on error.
+type TransMessage struct {
+	Stdout string
+	Stderr string
+}
+
+// OutputVideo describes a single rendition produced for a task, ready to be
+// consumed by a downstream packager or HLS/DASH manifester.
+type OutputVideo struct {
+	// Profile is the name of the EncodedProfile this output was produced from.
+	Profile string
+	// Url is the final, reachable location of the output file.
+	Url string
+	// Size is the output file size in bytes.
+	Size int64
+	// Duration is the output media duration in seconds.
+	Duration float64
+}
+
+// Call is the payload posted to the configured callback address once a task finishes.
+type Call struct {
+	Code         int
+	Error        string
+	ErrorMessage error
+	Task         Task
+	Message      TransMessage
+	// Outputs lists one entry per rendition produced for Task, in the same
+	// order as Task.Profiles.
+	Outputs []OutputVideo
+}
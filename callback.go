@@ -0,0 +1,214 @@
+package go_trans
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tangs-drm/go-trans/log"
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// DefaultCallbackSecretHeader is the header carrying the HMAC signature of
+// the callback body, in the style of GitHub/Stripe webhooks.
+const DefaultCallbackSecretHeader = "X-Trans-Signature"
+
+// RetryPolicy controls how CallBack backs off between delivery attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of delivery attempts, including the first.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff before jitter is applied. A
+	// Retry-After delay sent by the server is used as given, without this cap.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retryable failure.
+	Multiplier float64
+	// Jitter is a fraction (0-1) of the computed delay to randomly add or subtract.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used when a TransManage has no RetryPolicy set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 1 * time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// SetCallbackAuth signs every callback body with HMAC-SHA256 using secret,
+// carried in header as "sha256=<hex>" (GitHub/Stripe style). An empty
+// header falls back to DefaultCallbackSecretHeader.
+func SetCallbackAuth(secret, header string) {
+	DefaultTransManager.SetCallbackAuth(secret, header)
+}
+
+func (tm *TransManage) SetCallbackAuth(secret, header string) {
+	tm.CallbackSecret = secret
+	if header == "" {
+		header = DefaultCallbackSecretHeader
+	}
+	tm.CallbackSecretHeader = header
+}
+
+// SetCallbackRetryPolicy overrides the default backoff used between
+// callback delivery attempts.
+func SetCallbackRetryPolicy(policy RetryPolicy) {
+	DefaultTransManager.SetCallbackRetryPolicy(policy)
+}
+
+func (tm *TransManage) SetCallbackRetryPolicy(policy RetryPolicy) {
+	tm.RetryPolicy = policy
+}
+
+// CallBack posts call to tm.Address, signing the body when a callback
+// secret is configured, and retries with exponential backoff and jitter on
+// retryable failures. Each attempt's count and time are recorded on task and
+// written through tm.Store; a delivery still pending when the process stops
+// is not resumed on restart. Once every attempt has failed with a retryable
+// error it returns TransTooManyTimes.
+func (tm *TransManage) CallBack(task *Task, call Call) error {
+	if "" == tm.Address {
+		log.W("CallBack will return because of empty address")
+		return nil
+	}
+
+	var policy = tm.RetryPolicy
+	if policy.MaxAttempts <= 0 {
+		policy = DefaultRetryPolicy
+	}
+
+	var body = util.S2Json(call)
+	var backoff = policy.InitialBackoff
+
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		task.CallbackRetryCount = attempt
+		task.LastCallbackAttempt = time.Now()
+		if err := tm.Store.Update(task); err != nil {
+			log.E("CallBack error persisting delivery state for task %v: %v", task.Id, err)
+		}
+
+		var retryAfter, retryable, err = tm.deliverCallback(body)
+		if err == nil {
+			log.W("CallBack with attempt: %v, address: %v, call: %v success", attempt, tm.Address, body)
+			return nil
+		}
+		log.W("CallBack with attempt: %v, address: %v, call: %v error: %v", attempt, tm.Address, body, err)
+
+		if !retryable {
+			return err
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+
+		var sleep = backoff
+		if retryAfter > 0 {
+			sleep = retryAfter
+		}
+		time.Sleep(withJitter(sleep, policy.Jitter))
+
+		backoff = time.Duration(float64(backoff) * policy.Multiplier)
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+	return util.NewError("%v", TransTooManyTimes)
+}
+
+// deliverCallback performs a single signed POST of body to tm.Address. It
+// returns the server's requested Retry-After delay (zero if absent/not
+// applicable), whether the failure is worth retrying, and the error itself.
+func (tm *TransManage) deliverCallback(body string) (time.Duration, bool, error) {
+	var req, err = http.NewRequest(http.MethodPost, tm.Address, strings.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if "" != tm.CallbackSecret {
+		req.Header.Set(tm.callbackSecretHeader(), signCallbackBody(tm.CallbackSecret, body))
+	}
+
+	var client = tm.callbackHTTPClient()
+	var resp *http.Response
+	resp, err = client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	if http.StatusOK == resp.StatusCode {
+		return 0, false, nil
+	}
+
+	var retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	var err2 = util.NewError("callback responded with status: %v", resp.StatusCode)
+	if isRetryableStatus(resp.StatusCode) {
+		return retryAfter, true, err2
+	}
+	return 0, false, err2
+}
+
+func (tm *TransManage) callbackSecretHeader() string {
+	if "" == tm.CallbackSecretHeader {
+		return DefaultCallbackSecretHeader
+	}
+	return tm.CallbackSecretHeader
+}
+
+// callbackHTTPClient returns the client used to deliver callbacks: the one
+// configured by SetCallbackTLSConfig, or http.DefaultClient otherwise.
+func (tm *TransManage) callbackHTTPClient() *http.Client {
+	if tm.callbackClient != nil {
+		return tm.callbackClient
+	}
+	return http.DefaultClient
+}
+
+func signCallbackBody(secret, body string) string {
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isRetryableStatus reports whether a non-200 status is worth retrying:
+// 5xx, 429 and 408 are, every other 4xx is terminal.
+func isRetryableStatus(code int) bool {
+	if code >= 500 {
+		return true
+	}
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+// parseRetryAfter reads a Retry-After header expressed in seconds. Other
+// forms (HTTP-date) aren't used by our callback targets, so they're ignored.
+func parseRetryAfter(value string) time.Duration {
+	if "" == value {
+		return 0
+	}
+	var seconds, err = strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// withJitter randomly adjusts d by up to +/- fraction of itself.
+func withJitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	var delta = float64(d) * fraction
+	var offset = (rand.Float64()*2 - 1) * delta
+	var result = time.Duration(float64(d) + offset)
+	if result < 0 {
+		return 0
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package go_trans
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSignCallbackBody(t *testing.T) {
+	var sig = signCallbackBody("secret", `{"hello":"world"}`)
+	if sig != "sha256=2677ad3e7c090b2fa2c0fb13020d66d5420879b8316eb356a2d60fb9073bc778" {
+		t.Fatalf("unexpected signature: %v", sig)
+	}
+
+	// Same secret and body must always sign the same way.
+	if sig2 := signCallbackBody("secret", `{"hello":"world"}`); sig != sig2 {
+		t.Fatalf("signature not deterministic: %v != %v", sig, sig2)
+	}
+
+	// A different secret must change the signature.
+	if sig3 := signCallbackBody("other", `{"hello":"world"}`); sig3 == sig {
+		t.Fatalf("different secrets produced the same signature")
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	var cases = map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+	}
+	for code, want := range cases {
+		if got := isRetryableStatus(code); got != want {
+			t.Errorf("isRetryableStatus(%v) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	var cases = []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"-5", 0},
+		{"not-a-number", 0},
+		{"5", 5 * time.Second},
+		{"30", 30 * time.Second},
+	}
+	for _, c := range cases {
+		if got := parseRetryAfter(c.value); got != c.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", c.value, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package go_trans
+
+const (
+	// TransNotFound is returned when a task id can't be found in the task list.
+	TransNotFound = "task not found"
+	// TransTooManyTimes is returned when CallBack exhausts its retry budget.
+	TransTooManyTimes = "callback retry too many times"
+)
+
+// ErrorCode maps a plugin status code (the int returned by Execer.Exec or
+// CtxExecer.ExecCtx) to a human readable message.
+var ErrorCode = map[int]string{
+	0: "success",
+	1: "error",
+}
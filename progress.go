@@ -0,0 +1,266 @@
+package go_trans
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tangs-drm/go-trans/log"
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// DefaultProgressInterval is how often a running task's progress is sampled
+// when TransManage.ProgressInterval is unset.
+var DefaultProgressInterval = 2 * time.Second
+
+// ProgressCall is the payload posted to tm.Address while a task is running,
+// delivered over the same signed webhook path as the final result callback.
+type ProgressCall struct {
+	Type   string
+	TaskId string
+
+	Percent float64
+	Fps     float64
+	Time    float64
+	Speed   float64
+	// ETA is the estimated time remaining, in seconds.
+	ETA float64
+}
+
+// SetProgressInterval overrides how often a running task's progress is
+// sampled. This method is called if it needs to be executed before RunTask().
+func SetProgressInterval(interval time.Duration) {
+	DefaultTransManager.SetProgressInterval(interval)
+}
+
+func (tm *TransManage) SetProgressInterval(interval time.Duration) {
+	tm.ProgressInterval = interval
+}
+
+func (tm *TransManage) progressInterval() time.Duration {
+	if tm.ProgressInterval <= 0 {
+		return DefaultProgressInterval
+	}
+	return tm.ProgressInterval
+}
+
+// startProgress launches a goroutine that samples task.Plugin.Progress() on
+// tm.progressInterval() until stopProgress(task.Id) is called. exec calls
+// this before Plugin.Exec and stops it right after Plugin.Exec returns, so
+// the sampler never outlives its task.
+func (tm *TransManage) startProgress(task *Task) {
+	var stop = make(chan struct{})
+	var wg = &sync.WaitGroup{}
+	wg.Add(1)
+
+	tm.lock.Lock()
+	if tm.progressStops == nil {
+		tm.progressStops = map[string]chan struct{}{}
+	}
+	if tm.progressWg == nil {
+		tm.progressWg = map[string]*sync.WaitGroup{}
+	}
+	tm.progressStops[task.Id] = stop
+	tm.progressWg[task.Id] = wg
+	tm.lock.Unlock()
+
+	go tm.sampleProgress(task, stop, wg)
+}
+
+// stopProgress stops task's progress sampler, if one is still running, and
+// blocks until it has fully returned, so the caller can safely read or
+// mutate task once stopProgress is done.
+func (tm *TransManage) stopProgress(taskId string) {
+	tm.lock.Lock()
+	var wg = tm.stopProgressLocked(taskId)
+	tm.lock.Unlock()
+
+	if wg != nil {
+		wg.Wait()
+	}
+}
+
+// stopProgressLocked is stopProgress for callers that already hold tm.lock.
+// It signals the sampler to stop and returns its WaitGroup; callers that
+// need the synchronous guarantee stopProgress gives must Wait() on it only
+// after releasing tm.lock, since sampleProgress itself takes tm.lock.
+func (tm *TransManage) stopProgressLocked(taskId string) *sync.WaitGroup {
+	var stop, ok = tm.progressStops[taskId]
+	if !ok {
+		return nil
+	}
+	close(stop)
+	delete(tm.progressStops, taskId)
+
+	var wg = tm.progressWg[taskId]
+	delete(tm.progressWg, taskId)
+	return wg
+}
+
+func (tm *TransManage) sampleProgress(task *Task, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var ticker = time.NewTicker(tm.progressInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			var progress, err = task.Plugin.Progress()
+			if err != nil {
+				log.W("sampleProgress error reading progress for task %v: %v", task.Id, err)
+				continue
+			}
+
+			// task.Progress is read by exec once stopProgress returns, so
+			// mutate it under tm.lock the same way every other task field is.
+			tm.lock.Lock()
+			task.Progress = progress
+			tm.lock.Unlock()
+
+			if err := tm.Store.Update(task); err != nil {
+				log.E("sampleProgress error persisting progress for task %v: %v", task.Id, err)
+			}
+
+			var call = newProgressCall(task.Id, progress)
+			var data = util.S2Json(call)
+			broadcastProgress(task.Id, data)
+			tm.sendProgressCallback(data)
+		}
+	}
+}
+
+func newProgressCall(taskId string, progress map[string]interface{}) ProgressCall {
+	return ProgressCall{
+		Type:    "progress",
+		TaskId:  taskId,
+		Percent: progressFloat(progress, "percent"),
+		Fps:     progressFloat(progress, "fps"),
+		Time:    progressFloat(progress, "time"),
+		Speed:   progressFloat(progress, "speed"),
+		ETA:     progressFloat(progress, "eta"),
+	}
+}
+
+func progressFloat(progress map[string]interface{}, key string) float64 {
+	switch v := progress[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// sendProgressCallback delivers a progress payload to tm.Address, signed
+// the same way as a result callback. Unlike CallBack, a failed delivery is
+// just logged: the next sample a couple seconds later supersedes it anyway.
+func (tm *TransManage) sendProgressCallback(body string) {
+	if "" == tm.Address {
+		return
+	}
+	if _, _, err := tm.deliverCallback(body); err != nil {
+		log.W("sendProgressCallback error delivering to address: %v, error: %v", tm.Address, err)
+	}
+}
+
+// progressSubs holds the live SSE subscribers for each task id.
+var progressSubs = struct {
+	lock sync.Mutex
+	subs map[string]map[chan string]struct{}
+}{subs: map[string]map[chan string]struct{}{}}
+
+func subscribeProgress(taskId string) chan string {
+	var ch = make(chan string, 8)
+
+	progressSubs.lock.Lock()
+	defer progressSubs.lock.Unlock()
+	if progressSubs.subs[taskId] == nil {
+		progressSubs.subs[taskId] = map[chan string]struct{}{}
+	}
+	progressSubs.subs[taskId][ch] = struct{}{}
+	return ch
+}
+
+func unsubscribeProgress(taskId string, ch chan string) {
+	progressSubs.lock.Lock()
+	defer progressSubs.lock.Unlock()
+	delete(progressSubs.subs[taskId], ch)
+	close(ch)
+}
+
+func broadcastProgress(taskId, data string) {
+	progressSubs.lock.Lock()
+	defer progressSubs.lock.Unlock()
+	for ch := range progressSubs.subs[taskId] {
+		select {
+		case ch <- data:
+		default:
+			// Slow subscriber; drop the sample rather than block the sampler.
+		}
+	}
+}
+
+// ProgressHandler serves Server-Sent Events at /tasks/{id}/progress so UIs
+// can subscribe to a task's live progress instead of polling ListTask.
+func ProgressHandler() http.Handler {
+	return DefaultTransManager.ProgressHandler()
+}
+
+func (tm *TransManage) ProgressHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var taskId = parseProgressTaskId(r.URL.Path)
+		if "" == taskId {
+			http.NotFound(w, r)
+			return
+		}
+
+		var flusher, ok = w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		var ch = subscribeProgress(taskId)
+		defer unsubscribeProgress(taskId, ch)
+
+		for {
+			select {
+			case data, ok := <-ch:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+// parseProgressTaskId extracts {id} from a "/tasks/{id}/progress" path, or
+// returns "" if the path doesn't match.
+func parseProgressTaskId(path string) string {
+	var trimmed = strings.TrimPrefix(path, "/tasks/")
+	if trimmed == path {
+		return ""
+	}
+	if !strings.HasSuffix(trimmed, "/progress") {
+		return ""
+	}
+	trimmed = strings.TrimSuffix(trimmed, "/progress")
+	if trimmed == "" || strings.Contains(trimmed, "/") {
+		return ""
+	}
+	return trimmed
+}
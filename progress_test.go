@@ -0,0 +1,19 @@
+package go_trans
+
+import "testing"
+
+func TestParseProgressTaskId(t *testing.T) {
+	var cases = map[string]string{
+		"/tasks/abc123/progress":  "abc123",
+		"/tasks/abc123":           "",
+		"/tasks//progress":        "",
+		"/tasks/abc/def/progress": "",
+		"/other/abc123/progress":  "",
+		"/tasks/progress":         "",
+	}
+	for path, want := range cases {
+		if got := parseProgressTaskId(path); got != want {
+			t.Errorf("parseProgressTaskId(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
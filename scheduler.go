@@ -0,0 +1,154 @@
+package go_trans
+
+import (
+	"context"
+
+	"github.com/tangs-drm/go-trans/log"
+)
+
+// RunTask starts the default TransManage's worker pool and reloads any
+// tasks left pending by a previous run.
+func RunTask() {
+	DefaultTransManager.RunTask()
+}
+
+// RunTask starts MaxRunningNum long-lived workers plus a dispatcher that
+// feeds them the highest-priority waiting task, then reloads pending tasks
+// from the store. Call it once; it is a no-op if already running.
+func (tm *TransManage) RunTask() {
+	tm.lock.Lock()
+	if tm.jobs != nil {
+		tm.lock.Unlock()
+		return
+	}
+	tm.jobs = make(chan *Task, 256)
+	tm.quit = make(chan struct{})
+	tm.lock.Unlock()
+
+	for i := 0; i < tm.MaxRunningNum; i++ {
+		tm.workersWg.Add(1)
+		go tm.worker()
+	}
+	go tm.dispatch()
+
+	tm.recoverTasks()
+}
+
+// worker pulls at most one task at a time off tm.jobs and runs it, so
+// CurrentRunning never exceeds MaxRunningNum workers.
+func (tm *TransManage) worker() {
+	defer tm.workersWg.Done()
+	for {
+		select {
+		case task := <-tm.jobs:
+			tm.lock.Lock()
+			tm.CurrentRunning++
+			tm.lock.Unlock()
+
+			tm.exec(task)
+
+			tm.lock.Lock()
+			tm.CurrentRunning--
+			tm.lock.Unlock()
+		case <-tm.quit:
+			return
+		}
+	}
+}
+
+// dispatch wakes on every tm.sign pulse (a task was added or recovered) and
+// feeds the highest-priority waiting task to a worker.
+func (tm *TransManage) dispatch() {
+	for {
+		select {
+		case <-tm.quit:
+			return
+		case <-tm.sign:
+		}
+
+		tm.lock.Lock()
+		if tm.closed {
+			tm.lock.Unlock()
+			continue
+		}
+		var next = tm.popWaiting()
+		tm.lock.Unlock()
+
+		if next == nil {
+			continue
+		}
+
+		// Store.Update can be a disk or network round trip; do it off
+		// tm.lock so a slow store only delays this task, not every other
+		// caller contending on the lock.
+		if err := tm.Store.Update(next); err != nil {
+			log.E("dispatch error updating task %v to Running in store: %v", next.Id, err)
+		}
+
+		select {
+		case tm.jobs <- next:
+		case <-tm.quit:
+			return
+		}
+	}
+}
+
+// popWaiting returns the highest-Priority TASK_WAITING task in tm.Tasks,
+// marking it TransRunning so it isn't picked twice; the task stays in
+// tm.Tasks. Callers must hold tm.lock. Returns nil if nothing is waiting.
+func (tm *TransManage) popWaiting() *Task {
+	var best = -1
+	for i, task := range tm.Tasks {
+		if task.Status != TASK_WAITING {
+			continue
+		}
+		if best == -1 || task.Priority > tm.Tasks[best].Priority {
+			best = i
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+
+	var task = tm.Tasks[best]
+	task.Status = TransRunning
+	return task
+}
+
+// Shutdown stops the default TransManage. See TransManage.Shutdown.
+func Shutdown(ctx context.Context) error {
+	return DefaultTransManager.Shutdown(ctx)
+}
+
+// Shutdown refuses new tasks and waits for running ones to finish. If ctx
+// expires first, it cancels every still-running task and returns ctx.Err()
+// without waiting further.
+func (tm *TransManage) Shutdown(ctx context.Context) error {
+	tm.lock.Lock()
+	if tm.closed {
+		tm.lock.Unlock()
+		return nil
+	}
+	tm.closed = true
+	close(tm.quit)
+	tm.lock.Unlock()
+
+	var done = make(chan struct{})
+	go func() {
+		tm.workersWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		tm.lock.Lock()
+		for taskId, cancel := range tm.cancels {
+			tm.stopProgressLocked(taskId)
+			cancel()
+		}
+		tm.lock.Unlock()
+		return ctx.Err()
+	}
+}
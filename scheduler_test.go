@@ -0,0 +1,33 @@
+package go_trans
+
+import "testing"
+
+func TestPopWaitingPicksHighestPriority(t *testing.T) {
+	var tm = &TransManage{
+		Tasks: []*Task{
+			{Id: "low", Status: TASK_WAITING, Priority: 1},
+			{Id: "high", Status: TASK_WAITING, Priority: 5},
+			{Id: "running", Status: TransRunning, Priority: 9},
+		},
+	}
+
+	var next = tm.popWaiting()
+	if next == nil || next.Id != "high" {
+		t.Fatalf("popWaiting() = %v, want task \"high\"", next)
+	}
+	if next.Status != TransRunning {
+		t.Errorf("popWaiting() left task %v Status = %v, want TransRunning", next.Id, next.Status)
+	}
+}
+
+func TestPopWaitingNoneWaiting(t *testing.T) {
+	var tm = &TransManage{
+		Tasks: []*Task{
+			{Id: "done", Status: TransSuccess},
+		},
+	}
+
+	if next := tm.popWaiting(); next != nil {
+		t.Fatalf("popWaiting() = %v, want nil", next)
+	}
+}
@@ -0,0 +1,94 @@
+package go_trans
+
+import (
+	"sync"
+
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// TaskStore persists task state so that a process restart does not lose
+// queue state and running tasks are not orphaned.
+type TaskStore interface {
+	// Put persists a newly created task.
+	Put(task *Task) error
+	// Update persists the current state of an existing task.
+	Update(task *Task) error
+	// Get returns the task with the given id, or an error if it's not found.
+	Get(taskId string) (*Task, error)
+	// List returns every task currently in the store.
+	List() ([]*Task, error)
+	// Delete removes a task from the store.
+	Delete(taskId string) error
+	// LoadPending returns tasks that were TransRunning or TASK_WAITING when
+	// the process last stopped, so RunTask can resume or fail them.
+	LoadPending() ([]*Task, error)
+}
+
+// MemoryTaskStore is the default TaskStore: it keeps tasks in a process-local
+// map and does not survive a restart. It exists so TransManage always has a
+// store to write through, even before SetTaskStore is called.
+type MemoryTaskStore struct {
+	lock  sync.RWMutex
+	tasks map[string]*Task
+}
+
+// NewMemoryTaskStore creates an empty MemoryTaskStore.
+func NewMemoryTaskStore() *MemoryTaskStore {
+	return &MemoryTaskStore{
+		tasks: map[string]*Task{},
+	}
+}
+
+func (s *MemoryTaskStore) Put(task *Task) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var clone = *task
+	s.tasks[task.Id] = &clone
+	return nil
+}
+
+func (s *MemoryTaskStore) Update(task *Task) error {
+	return s.Put(task)
+}
+
+func (s *MemoryTaskStore) Get(taskId string) (*Task, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var task, ok = s.tasks[taskId]
+	if !ok {
+		return nil, util.NewError("%v", TransNotFound)
+	}
+	var clone = *task
+	return &clone, nil
+}
+
+func (s *MemoryTaskStore) List() ([]*Task, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var tasks = make([]*Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		var clone = *task
+		tasks = append(tasks, &clone)
+	}
+	return tasks, nil
+}
+
+func (s *MemoryTaskStore) Delete(taskId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.tasks, taskId)
+	return nil
+}
+
+func (s *MemoryTaskStore) LoadPending() ([]*Task, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var tasks []*Task
+	for _, task := range s.tasks {
+		if task.Status == TransRunning || task.Status == TASK_WAITING {
+			var clone = *task
+			tasks = append(tasks, &clone)
+		}
+	}
+	return tasks, nil
+}
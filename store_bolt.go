@@ -0,0 +1,102 @@
+//go:build bolt
+// +build bolt
+
+package go_trans
+
+// This file is only built with -tags bolt, so picking the in-memory,
+// SQLite, or Redis store doesn't also pull in BoltDB.
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/tangs-drm/go-trans/util"
+)
+
+var tasksBucket = []byte("tasks")
+
+// BoltTaskStore is a TaskStore backed by a local BoltDB file, useful for a
+// single-process deployment that still needs crash recovery.
+type BoltTaskStore struct {
+	db *bolt.DB
+}
+
+// NewBoltTaskStore opens (creating if necessary) a BoltDB file at path and
+// ensures the tasks bucket exists.
+func NewBoltTaskStore(path string) (*BoltTaskStore, error) {
+	var db, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, util.NewError("open bolt store %v: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		var _, err = tx.CreateBucketIfNotExists(tasksBucket)
+		return err
+	})
+	if err != nil {
+		return nil, util.NewError("init bolt store %v: %v", path, err)
+	}
+	return &BoltTaskStore{db: db}, nil
+}
+
+func (s *BoltTaskStore) Put(task *Task) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(task.Id), []byte(util.S2Json(task)))
+	})
+}
+
+func (s *BoltTaskStore) Update(task *Task) error {
+	return s.Put(task)
+}
+
+func (s *BoltTaskStore) Get(taskId string) (*Task, error) {
+	var task Task
+	var found bool
+	var err = s.db.View(func(tx *bolt.Tx) error {
+		var data = tx.Bucket(tasksBucket).Get([]byte(taskId))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return util.Json2S(string(data), &task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, util.NewError("%v", TransNotFound)
+	}
+	return &task, nil
+}
+
+func (s *BoltTaskStore) List() ([]*Task, error) {
+	var tasks []*Task
+	var err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			var task Task
+			if err := util.Json2S(string(v), &task); err != nil {
+				return err
+			}
+			tasks = append(tasks, &task)
+			return nil
+		})
+	})
+	return tasks, err
+}
+
+func (s *BoltTaskStore) Delete(taskId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Delete([]byte(taskId))
+	})
+}
+
+func (s *BoltTaskStore) LoadPending() ([]*Task, error) {
+	var all, err = s.List()
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for _, task := range all {
+		if task.Status == TransRunning || task.Status == TASK_WAITING {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
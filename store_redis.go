@@ -0,0 +1,91 @@
+//go:build redis
+// +build redis
+
+package go_trans
+
+// This file is only built with -tags redis, so picking the in-memory,
+// BoltDB, or SQLite store doesn't also pull in a Redis client.
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// RedisTaskStore is a TaskStore backed by Redis, useful when several
+// TransManage processes need to share one queue.
+type RedisTaskStore struct {
+	client *redis.Client
+	// keyPrefix namespaces this store's keys within a shared Redis instance.
+	keyPrefix string
+}
+
+// NewRedisTaskStore creates a RedisTaskStore on top of an existing client.
+// keyPrefix is prepended to every key it writes, e.g. "go-trans:task:".
+func NewRedisTaskStore(client *redis.Client, keyPrefix string) *RedisTaskStore {
+	return &RedisTaskStore{client: client, keyPrefix: keyPrefix}
+}
+
+func (s *RedisTaskStore) key(taskId string) string {
+	return s.keyPrefix + taskId
+}
+
+func (s *RedisTaskStore) Put(task *Task) error {
+	return s.client.Set(s.key(task.Id), util.S2Json(task), 0).Err()
+}
+
+func (s *RedisTaskStore) Update(task *Task) error {
+	return s.Put(task)
+}
+
+func (s *RedisTaskStore) Get(taskId string) (*Task, error) {
+	var data, err = s.client.Get(s.key(taskId)).Result()
+	if err == redis.Nil {
+		return nil, util.NewError("%v", TransNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := util.Json2S(data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (s *RedisTaskStore) List() ([]*Task, error) {
+	var keys, err = s.client.Keys(s.keyPrefix + "*").Result()
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for _, key := range keys {
+		var data, err = s.client.Get(key).Result()
+		if err != nil {
+			continue
+		}
+		var task Task
+		if err := util.Json2S(data, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (s *RedisTaskStore) Delete(taskId string) error {
+	return s.client.Del(s.key(taskId)).Err()
+}
+
+func (s *RedisTaskStore) LoadPending() ([]*Task, error) {
+	var all, err = s.List()
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for _, task := range all {
+		if task.Status == TransRunning || task.Status == TASK_WAITING {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
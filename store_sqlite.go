@@ -0,0 +1,115 @@
+//go:build sqlite
+// +build sqlite
+
+package go_trans
+
+// This file is only built with -tags sqlite, so picking the in-memory,
+// BoltDB, or Redis store doesn't also pull in the cgo-based go-sqlite3
+// driver.
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// SQLiteTaskStore is a TaskStore backed by a local SQLite database.
+type SQLiteTaskStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteTaskStore opens (creating if necessary) a SQLite database at path
+// and ensures the tasks table exists.
+func NewSQLiteTaskStore(path string) (*SQLiteTaskStore, error) {
+	var db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, util.NewError("open sqlite store %v: %v", path, err)
+	}
+	_, err = db.Exec(`create table if not exists tasks (
+		id text primary key,
+		status text not null,
+		data text not null
+	)`)
+	if err != nil {
+		return nil, util.NewError("init sqlite store %v: %v", path, err)
+	}
+	return &SQLiteTaskStore{db: db}, nil
+}
+
+func (s *SQLiteTaskStore) Put(task *Task) error {
+	var _, err = s.db.Exec(
+		`insert into tasks (id, status, data) values (?, ?, ?)
+		 on conflict(id) do update set status = excluded.status, data = excluded.data`,
+		task.Id, task.Status, util.S2Json(task))
+	return err
+}
+
+func (s *SQLiteTaskStore) Update(task *Task) error {
+	return s.Put(task)
+}
+
+func (s *SQLiteTaskStore) Get(taskId string) (*Task, error) {
+	var data string
+	var err = s.db.QueryRow(`select data from tasks where id = ?`, taskId).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, util.NewError("%v", TransNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := util.Json2S(data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (s *SQLiteTaskStore) List() ([]*Task, error) {
+	var rows, err = s.db.Query(`select data from tasks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var task Task
+		if err := util.Json2S(data, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *SQLiteTaskStore) Delete(taskId string) error {
+	var _, err = s.db.Exec(`delete from tasks where id = ?`, taskId)
+	return err
+}
+
+func (s *SQLiteTaskStore) LoadPending() ([]*Task, error) {
+	var rows, err = s.db.Query(`select data from tasks where status = ? or status = ?`, TransRunning, TASK_WAITING)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var task Task
+		if err := util.Json2S(data, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, rows.Err()
+}
@@ -0,0 +1,68 @@
+package go_trans
+
+import "time"
+
+// TASK_WAITING marks a task that has been queued but not yet picked up by a worker.
+const TASK_WAITING = "Waiting"
+
+// EncodedProfile describes a single output rendition that a plugin should
+// produce from one input, e.g. a 720p/1280000bps mp4 alongside a 360p/500000bps one.
+type EncodedProfile struct {
+	// Name identifies the profile, e.g. "720p", "360p".
+	Name string
+	// Width and Height are the output video dimensions in pixels.
+	Width  int
+	Height int
+	// VideoBitrate and AudioBitrate are in bits per second.
+	VideoBitrate int
+	AudioBitrate int
+	// Container is the output container/format, e.g. "mp4", "ts".
+	Container string
+	// Framerate is the output frames per second. Zero keeps the source framerate.
+	Framerate int
+}
+
+// Task describes a single transcoding job together with its runtime state.
+type Task struct {
+	Id     string
+	Input  string
+	Output string
+	Args   map[string]interface{}
+
+	// Profiles lists the renditions to produce from Input. AddTask rejects a
+	// task with no profiles; Output holds the first entry of Destinations.
+	Profiles []EncodedProfile
+	// Destinations holds one output path per entry in Profiles, in the same order.
+	Destinations []string
+
+	// Plugin is not persisted, so tasks returned by a TaskStore have a nil
+	// Plugin. RunTask recreates it from the registered factory for Input's
+	// extension when it re-enqueues a waiting task loaded from the store.
+	Plugin TransPlugin `json:"-"`
+	Status string
+
+	// Progress is the most recent sample read from Plugin.Progress() while
+	// the task is TransRunning.
+	Progress map[string]interface{}
+
+	// Priority lets a task jump the waiting queue: the dispatcher always
+	// picks the highest-Priority TASK_WAITING task next. Zero is normal priority.
+	Priority int
+
+	// Timeout bounds how long Exec is allowed to run, starting when the
+	// worker picks the task up. Zero means no timeout.
+	Timeout time.Duration
+	// Deadline, if set, is an absolute cutoff for Exec. Timeout takes
+	// precedence when both are set.
+	Deadline time.Time
+
+	// Resumable is set by RunTask when a task is found Running at startup
+	// and moved to TransError, signalling that it may be safely retried.
+	Resumable bool
+
+	// CallbackRetryCount and LastCallbackAttempt record webhook delivery
+	// state and are persisted through the TaskStore on every attempt. A
+	// delivery still pending when the process stops is not resumed on restart.
+	CallbackRetryCount  int
+	LastCallbackAttempt time.Time
+}
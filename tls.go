@@ -0,0 +1,131 @@
+package go_trans
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tangs-drm/go-trans/util"
+)
+
+// TLSConfig describes how the callback HTTP client should dial tm.Address:
+// the minimum TLS version, an optional cipher suite whitelist, an optional
+// client certificate for mTLS, an optional CA used to validate the server,
+// and a request timeout.
+type TLSConfig struct {
+	// CAFile, if set, is a PEM file used instead of the system trust store
+	// to validate the callback server's certificate.
+	CAFile string
+	// CertFile and KeyFile, if both set, are a PEM client certificate/key
+	// presented to the callback server (mTLS).
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the hostname used for SNI and verification.
+	ServerName string
+	// MinVersion is a TLS version string, e.g. "VersionTLS12".
+	MinVersion string
+	// CipherSuites whitelists IANA cipher suite names, e.g.
+	// "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384". Empty allows Go's default set.
+	CipherSuites []string
+	// InsecureSkipVerify disables server certificate verification. Only
+	// ever use this for local testing.
+	InsecureSkipVerify bool
+	// Timeout bounds the whole callback request/response round trip.
+	// Zero means no timeout, matching http.Client's own default.
+	Timeout time.Duration
+}
+
+// tlsVersions maps the version strings accepted by TLSConfig.MinVersion to
+// their crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// cipherSuiteIDs maps IANA cipher suite names, e.g.
+// "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", to their crypto/tls IDs.
+var cipherSuiteIDs = buildCipherSuiteIDs()
+
+func buildCipherSuiteIDs() map[string]uint16 {
+	var ids = map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	return ids
+}
+
+// SetCallbackTLSConfig hardens the HTTP client used to deliver callbacks:
+// it enforces a minimum TLS version and cipher suite whitelist, and can
+// present a client certificate for callback endpoints that require mTLS.
+func SetCallbackTLSConfig(config TLSConfig) error {
+	return DefaultTransManager.SetCallbackTLSConfig(config)
+}
+
+func (tm *TransManage) SetCallbackTLSConfig(config TLSConfig) error {
+	var tlsConfig, err = buildTLSConfig(config)
+	if err != nil {
+		return err
+	}
+
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+	tm.callbackClient = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	return nil
+}
+
+func buildTLSConfig(config TLSConfig) (*tls.Config, error) {
+	var tlsConfig = &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if "" != config.MinVersion {
+		var version, ok = tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, util.NewError("unknown TLS version: %v", config.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	for _, name := range config.CipherSuites {
+		var id, ok = cipherSuiteIDs[name]
+		if !ok {
+			return nil, util.NewError("unknown cipher suite: %v", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+
+	if "" != config.CAFile {
+		var pem, err = ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, util.NewError("read CA file %v: %v", config.CAFile, err)
+		}
+		var pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, util.NewError("no certificates found in CA file: %v", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if "" != config.CertFile && "" != config.KeyFile {
+		var cert, err = tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, util.NewError("load client certificate %v/%v: %v", config.CertFile, config.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
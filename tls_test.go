@@ -0,0 +1,55 @@
+package go_trans
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestBuildTLSConfig(t *testing.T) {
+	var config, err = buildTLSConfig(TLSConfig{
+		ServerName:         "trans.example.com",
+		MinVersion:         "VersionTLS12",
+		CipherSuites:       []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("buildTLSConfig returned error: %v", err)
+	}
+	if config.ServerName != "trans.example.com" {
+		t.Errorf("ServerName = %v, want trans.example.com", config.ServerName)
+	}
+	if !config.InsecureSkipVerify {
+		t.Errorf("InsecureSkipVerify = false, want true")
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %v, want %v", config.MinVersion, tls.VersionTLS12)
+	}
+	if len(config.CipherSuites) != 1 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("CipherSuites = %v, want [%v]", config.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384)
+	}
+}
+
+func TestBuildTLSConfigUnknownVersion(t *testing.T) {
+	if _, err := buildTLSConfig(TLSConfig{MinVersion: "VersionTLS99"}); err == nil {
+		t.Fatalf("expected an error for an unknown TLS version")
+	}
+}
+
+func TestBuildTLSConfigUnknownCipherSuite(t *testing.T) {
+	if _, err := buildTLSConfig(TLSConfig{CipherSuites: []string{"NOT_A_REAL_SUITE"}}); err == nil {
+		t.Fatalf("expected an error for an unknown cipher suite")
+	}
+}
+
+func TestBuildTLSConfigDefaults(t *testing.T) {
+	var config, err = buildTLSConfig(TLSConfig{})
+	if err != nil {
+		t.Fatalf("buildTLSConfig returned error: %v", err)
+	}
+	if config.MinVersion != 0 {
+		t.Errorf("MinVersion = %v, want 0 (unset)", config.MinVersion)
+	}
+	if config.RootCAs != nil {
+		t.Errorf("RootCAs = %v, want nil", config.RootCAs)
+	}
+}
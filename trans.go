@@ -1,43 +1,92 @@
 package go_trans
 
 import (
+	"context"
+
 	"github.com/tangs-drm/go-trans/log"
 	"github.com/tangs-drm/go-trans/util"
-	"math/rand"
 	"net/http"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 )
 
+// TransPlugin is the minimal interface every transcode plug-in must
+// implement. A plugin also implements either Execer or CtxExecer (below) to
+// actually run a transcode; TransPlugin itself only covers what both eras of
+// plugin have in common, so chunk0-1-style plugins keep compiling unchanged
+// after chunk0-7 added ctx support.
 type TransPlugin interface {
 	// Return the type of the transcode plug-in
 	Type() string
 
-	// Start the transcoding task.
+	// Progress return the current transcoding progress.
+	//
+	// map[string]interface{}:
+	// error: error message.
+	Progress() (map[string]interface{}, error)
+}
+
+// Execer is implemented by plugins written before chunk0-7, which run a
+// transcode with no way to observe cancellation or a deadline.
+type Execer interface {
+	TransPlugin
+
+	// Start the transcoding task, producing one output file per profile
+	// from a single input, e.g. a set of ABR renditions.
 	//
 	// input: Input file name.
-	// output: Output file name.
+	// profiles: The encoding profile of each rendition to produce.
+	// destinations: Output file name for each profile, same order and length as profiles.
 	// args: The parameters of the transcoding execution, such as
 	//		{"-b:v": 1200000, "-r": 30}.
 	//
 	// int: Status code, see error.go for detail.
+	// []OutputVideo: One entry per profile, describing the produced rendition.
 	// TransMessage: The output information of the transcoding,
 	// 		including the printing information of the transcoding success
 	// 		and the failure of the transcoding.
 	// error: NewError information of the system.
-	Exec(input, output string, args map[string]interface{}) (int, TransMessage, error)
-
-	// Cancel the current transcoding task.
-	// error: error message.
-	Cancel() error
+	Exec(input string, profiles []EncodedProfile, destinations []string, args map[string]interface{}) (int, []OutputVideo, TransMessage, error)
+}
 
-	// Progress return the current transcoding progress.
+// CtxExecer is implemented by plugins that support ctx-based cancellation
+// and deadlines, added in chunk0-7. Prefer this over Execer when both are
+// implemented.
+type CtxExecer interface {
+	TransPlugin
+
+	// ExecCtx starts the transcoding task, producing one output file per
+	// profile from a single input, e.g. a set of ABR renditions. ctx bounds
+	// the call: an implementation should stop its own subprocess (e.g. via
+	// exec.CommandContext) as soon as ctx is done, instead of exposing a
+	// separate Cancel method that could race with a call already in flight.
 	//
-	// map[string]interface{}:
-	// error: error message.
-	Progress() (map[string]interface{}, error)
+	// ctx: Governs the deadline/cancellation of this call.
+	// input, profiles, destinations, args, and the return values are the
+	// same as Execer.Exec.
+	ExecCtx(ctx context.Context, input string, profiles []EncodedProfile, destinations []string, args map[string]interface{}) (int, []OutputVideo, TransMessage, error)
+}
+
+// runExec runs plugin's transcode, preferring ExecCtx (and so honoring ctx)
+// when the plugin implements CtxExecer; otherwise it falls back to the
+// older Execer.Exec, which cannot observe ctx cancellation or its deadline.
+func runExec(ctx context.Context, plugin TransPlugin, input string, profiles []EncodedProfile, destinations []string, args map[string]interface{}) (int, []OutputVideo, TransMessage, error) {
+	if p, ok := plugin.(CtxExecer); ok {
+		return p.ExecCtx(ctx, input, profiles, destinations, args)
+	}
+	if p, ok := plugin.(Execer); ok {
+		return p.Exec(input, profiles, destinations, args)
+	}
+	return 0, nil, TransMessage{}, util.NewError("plugin %v implements neither CtxExecer nor Execer", plugin.Type())
+}
+
+// Exec runs plugin's transcode with context.Background(), for callers that
+// don't need cancellation or a deadline. It's a default wrapper kept for
+// plugins written before chunk0-7's ctx support: it works with both
+// CtxExecer and the older Execer, preferring CtxExecer when available.
+func Exec(plugin TransPlugin, input string, profiles []EncodedProfile, destinations []string, args map[string]interface{}) (int, []OutputVideo, TransMessage, error) {
+	return runExec(context.Background(), plugin, input, profiles, destinations, args)
 }
 
 const (
@@ -62,13 +111,52 @@ type TransManage struct {
 	// Transcoding task list
 	Tasks []*Task
 
-	// Transcode callback error retry times.
-	TryTimes int
-	Status   string
+	Status string
 
 	// Callback address after transcoding
 	Address string
 
+	// RetryPolicy controls backoff between callback delivery attempts.
+	// Defaults to DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+
+	// CallbackSecret signs outgoing callback bodies with HMAC-SHA256 when
+	// non-empty; CallbackSecretHeader names the header carrying the
+	// signature (defaults to DefaultCallbackSecretHeader). Set via SetCallbackAuth.
+	CallbackSecret       string
+	CallbackSecretHeader string
+
+	// callbackClient delivers callbacks. Defaults to http.DefaultClient;
+	// set via SetCallbackTLSConfig to enforce TLS version/cipher/mTLS rules.
+	callbackClient *http.Client
+
+	// ProgressInterval is how often a running task's progress is sampled.
+	// Defaults to DefaultProgressInterval.
+	ProgressInterval time.Duration
+	// progressStops lets Cancel/Shutdown stop a task's progress sampler early.
+	progressStops map[string]chan struct{}
+	// progressWg lets stopProgress block until a task's in-flight progress
+	// sample has fully returned, so a caller that mutates or reads the task
+	// right after stopProgress can't race with the sampler.
+	progressWg map[string]*sync.WaitGroup
+
+	// cancels holds the cancel function of each running task's Exec
+	// context, so Cancel/Shutdown can stop it without a separate,
+	// racy plugin method.
+	cancels map[string]context.CancelFunc
+
+	// Store persists task state across restarts. Defaults to an in-memory
+	// store; call SetTaskStore to use BoltDB/SQLite/Redis instead (build
+	// with -tags bolt, sqlite, or redis respectively to include one).
+	Store TaskStore
+
+	// jobs feeds waiting tasks to the worker pool; quit tells the workers
+	// and the dispatcher to stop. Both are created by RunTask.
+	jobs      chan *Task
+	quit      chan struct{}
+	workersWg sync.WaitGroup
+	closed    bool
+
 	sign chan int
 	lock *sync.Mutex
 }
@@ -76,7 +164,6 @@ type TransManage struct {
 // The default number of transcoding threads
 var DefaultMaxRunningNum = 1
 
-var DefaultTryTimes = 1
 var DefaultFormats = []string{"flv"}
 
 // The default trans manager.
@@ -86,8 +173,9 @@ var DefaultTransManager = &TransManage{
 	Formats:        DefaultFormats,
 	TransPlugin:    map[string]func() TransPlugin{},
 	Tasks:          []*Task{},
-	TryTimes:       DefaultTryTimes,
 	Status:         TransNotStart,
+	Store:          NewMemoryTaskStore(),
+	RetryPolicy:    DefaultRetryPolicy,
 	sign:           make(chan int, 256),
 	lock:           &sync.Mutex{},
 }
@@ -140,112 +228,232 @@ func (tm *TransManage) SetCallbackAddress(addr string) {
 	tm.Address = addr
 }
 
+// SetTaskStore sets the TaskStore used to persist tasks. Call this before
+// AddTask/RunTask so that every mutation, including recovered tasks, goes
+// through the same store.
+func SetTaskStore(store TaskStore) {
+	DefaultTransManager.SetTaskStore(store)
+}
+
+func (tm *TransManage) SetTaskStore(store TaskStore) {
+	tm.Store = store
+}
+
 // AddTask add a transcoding task, but just add the transcoding queue at this time,
-// and do not really start transcoding.
+// and do not really start transcoding. One task may produce several renditions,
+// one per entry in profiles, each written to the matching entry in destinations.
 //
 // input: Input filename.
-// output: Output filename.
-func (tm *TransManage) AddTask(input, output string) (Task, error) {
+// profiles: The encoding profile of each rendition to produce.
+// destinations: Output filename for each profile, same order and length as profiles.
+func (tm *TransManage) AddTask(input string, profiles []EncodedProfile, destinations []string) (Task, error) {
+	var task, err = tm.newTask(input, profiles, destinations)
+	if err != nil {
+		return Task{}, err
+	}
+
+	// Store.Put can be a disk or network round trip (BoltDB/SQLite/Redis);
+	// keep it off tm.lock so a slow store doesn't stall every other caller.
+	if err = tm.Store.Put(task); err != nil {
+		log.E("AddTask error saving task to store: %v", err)
+		return Task{}, err
+	}
+
+	tm.lock.Lock()
+	tm.Tasks = append(tm.Tasks, task)
+	tm.lock.Unlock()
+
+	tm.sign <- 1
+
+	return *task, nil
+}
+
+// newTask validates input/profiles/destinations and builds the Task under
+// tm.lock, without touching the store.
+func (tm *TransManage) newTask(input string, profiles []EncodedProfile, destinations []string) (*Task, error) {
 	tm.lock.Lock()
 	defer tm.lock.Unlock()
 
-	// check input and output
+	if tm.closed {
+		var err = util.NewError("TransManage is shutting down, no new tasks accepted")
+		log.E("AddTask error: %v", err)
+		return nil, err
+	}
+
+	// check input and destinations
 	var inputExt = filepath.Ext(input)
-	var outputExt = filepath.Ext(output)
 	var err error
 
 	if "" == inputExt {
 		err = util.NewError("input is invalid: %v", input)
 		log.E("AddTask error with input: %v", err)
-		return Task{}, err
+		return nil, err
 	}
-	if "" == outputExt {
-		err = util.NewError("output is invalid: %v", output)
-		log.E("AddTask error with output: %v", err)
-		return Task{}, err
+	if len(profiles) == 0 {
+		err = util.NewError("profiles is empty")
+		log.E("AddTask error with profiles: %v", err)
+		return nil, err
+	}
+	if len(profiles) != len(destinations) {
+		err = util.NewError("profiles and destinations must have the same length: %v != %v", len(profiles), len(destinations))
+		log.E("AddTask error with destinations: %v", err)
+		return nil, err
+	}
+	for _, output := range destinations {
+		if "" == filepath.Ext(output) {
+			err = util.NewError("output is invalid: %v", output)
+			log.E("AddTask error with output: %v", err)
+			return nil, err
+		}
 	}
 	var plugin = tm.TransPlugin[inputExt]
 	if plugin == nil {
 		err = util.NewError("unsupported format: %v", inputExt)
 		log.E("AddTask error with format: %v", err)
-		return Task{}, err
-	}
-	var task = &Task{
-		Id:     util.UUID(),
-		Input:  input,
-		Output: output,
-		Plugin: plugin(),
+		return nil, err
 	}
-
-	// todo. save into database.
-	tm.Tasks = append(tm.Tasks, task)
-
-	tm.sign <- 1
-
-	return *task, nil
+	return &Task{
+		Id:           util.UUID(),
+		Input:        input,
+		Output:       destinations[0],
+		Profiles:     profiles,
+		Destinations: destinations,
+		Plugin:       plugin(),
+		Status:       TASK_WAITING,
+	}, nil
 }
 
-func RunTask() {
-	go DefaultTransManager.runTask()
-}
+// recoverTasks reloads tasks that were TransRunning or TASK_WAITING in the store
+// when the process last stopped. Waiting tasks are safe to re-enqueue as-is;
+// tasks caught mid-run are marked TransError with Resumable set, since we
+// can't know whether the underlying plugin finished the work.
+func (tm *TransManage) recoverTasks() {
+	var pending, err = tm.Store.LoadPending()
+	if err != nil {
+		log.E("runTask error loading pending tasks from store: %v", err)
+		return
+	}
 
-func (tm *TransManage) runTask() {
-	defer func() {
-		if err := recover(); err != nil {
-		}
-	}()
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
 
-	for {
-		<-tm.sign
-		if tm.CurrentRunning >= tm.MaxRunningNum {
+	for _, task := range pending {
+		if task.Status == TransRunning {
+			task.Status = TransError
+			task.Resumable = true
+			if err := tm.Store.Update(task); err != nil {
+				log.E("runTask error marking task %v resumable in store: %v", task.Id, err)
+			}
+			log.W("runTask found task %v Running at startup, marked TransError and resumable", task.Id)
 			continue
 		}
 
-		for _, task := range tm.Tasks {
-			if TASK_WAITING == task.Status {
-				continue
+		plugin, ok := tm.TransPlugin[filepath.Ext(task.Input)]
+		if !ok {
+			task.Status = TransError
+			task.Resumable = true
+			if err := tm.Store.Update(task); err != nil {
+				log.E("runTask error marking task %v resumable in store: %v", task.Id, err)
 			}
-			go tm.exec(task)
+			log.E("runTask found task %v with no registered plugin for %v at startup, marked TransError and resumable", task.Id, filepath.Ext(task.Input))
+			continue
 		}
+
+		task.Plugin = plugin()
+		tm.Tasks = append(tm.Tasks, task)
+		tm.sign <- 1
+		log.D("runTask re-enqueued waiting task %v from store", task.Id)
 	}
 }
 
 func (tm *TransManage) exec(task *Task) {
-	task.Status = TransRunning
-	code, result, err1 := task.Plugin.Exec(task.Input, task.Output, task.Args)
+	var ctx, cancel = tm.taskContext(task)
+	tm.lock.Lock()
+	if tm.cancels == nil {
+		tm.cancels = map[string]context.CancelFunc{}
+	}
+	tm.cancels[task.Id] = cancel
+	tm.lock.Unlock()
+	defer func() {
+		cancel()
+		tm.lock.Lock()
+		delete(tm.cancels, task.Id)
+		tm.lock.Unlock()
+	}()
+
+	tm.startProgress(task)
+	code, outputs, result, err1 := runExec(ctx, task.Plugin, task.Input, task.Profiles, task.Destinations, task.Args)
+	tm.stopProgress(task.Id)
+
+	// Cancel may have already set task.Status to TransCancel, persisted that,
+	// and popped the task from tm.Tasks/the store while we were blocked in
+	// ExecCtx. Check and transition the status under tm.lock, the same lock
+	// Cancel uses, so the two can't race; if we lost, a canceled task must
+	// stay canceled instead of being resurrected as Error/Success.
+	tm.lock.Lock()
+	if task.Status == TransCancel {
+		tm.lock.Unlock()
+		log.D("TransManage exec task: %v was canceled, discarding result", task.Id)
+		return
+	}
+	if err1 != nil {
+		task.Status = TransError
+	} else {
+		task.Status = TransSuccess
+	}
+	tm.lock.Unlock()
+
 	call := Call{
 		Code:         code,
 		Error:        ErrorCode[code],
 		ErrorMessage: err1,
 		Task:         *task,
 		Message:      result,
+		Outputs:      outputs,
 	}
 	if err1 != nil {
 		log.E("TransManage exec task: %v complete with code %v, err %v", util.S2Json(task), code, err1)
-		task.Status = TransError
 	} else {
 		log.D("TransManage exec task: %v complete with result: %v", util.S2Json(task), util.S2Json(result))
-		task.Status = TransSuccess
 	}
-	err2 := tm.CallBack(call)
+	if err := tm.Store.Update(task); err != nil {
+		log.E("exec error updating task %v status in store: %v", task.Id, err)
+	}
+	err2 := tm.CallBack(task, call)
 	if err2 != nil {
 		log.E("TransManage exec task: %v complete but error with callback: %v, error: %v", util.S2Json(task), util.S2Json(call), err2)
 	} else {
 		log.D("TransManage exec task: %v complete and callback success")
 	}
-	tm.sign <- 1
 
 	tm.lock.Lock()
 	tm.popTask(task.Id)
 	tm.lock.Unlock()
 }
 
+// taskContext derives the context passed to Plugin.ExecCtx: Timeout takes
+// precedence over Deadline when both are set, and a task with neither just
+// gets a cancellable context.
+func (tm *TransManage) taskContext(task *Task) (context.Context, context.CancelFunc) {
+	if task.Timeout > 0 {
+		return context.WithTimeout(context.Background(), task.Timeout)
+	}
+	if !task.Deadline.IsZero() {
+		return context.WithDeadline(context.Background(), task.Deadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
 func (tm *TransManage) popTask(taskId string) error {
 	for index, task := range tm.Tasks {
 		if task.Id != taskId {
 			continue
 		}
 
+		if err := tm.Store.Delete(taskId); err != nil {
+			log.E("popTask error deleting task %v from store: %v", taskId, err)
+		}
+
 		if 0 == index {
 			tm.Tasks = tm.Tasks[1:]
 			return nil
@@ -277,10 +485,14 @@ func (tm *TransManage) ListTask(limit, skip int) ([]Task, int) {
 	return nil, 0
 }
 
-// Cancel the transcoding process by taskId.
-// It will return error TransNotFound if can't find task.
-// todo. If exec Callback here?
-func (tm *TransManage) Cancel(taskId string) error {
+// SetPriority raises or lowers a queued task's priority so the dispatcher
+// reconsiders it sooner or later than other waiting tasks. It has no effect
+// once the task has left TASK_WAITING.
+func SetPriority(taskId string, priority int) error {
+	return DefaultTransManager.SetPriority(taskId, priority)
+}
+
+func (tm *TransManage) SetPriority(taskId string, priority int) error {
 	tm.lock.Lock()
 	defer tm.lock.Unlock()
 
@@ -288,44 +500,90 @@ func (tm *TransManage) Cancel(taskId string) error {
 		if task.Id != taskId {
 			continue
 		}
+		task.Priority = priority
+		return tm.Store.Update(task)
+	}
+	return util.NewError("%v", TransNotFound)
+}
+
+// SetTaskTimeout bounds how long taskId's Exec is allowed to run, starting
+// when a worker picks it up. Has no effect once the task is already running.
+func SetTaskTimeout(taskId string, timeout time.Duration) error {
+	return DefaultTransManager.SetTaskTimeout(taskId, timeout)
+}
 
-		var err = task.Plugin.Cancel()
-		if err != nil {
-			return err
+func (tm *TransManage) SetTaskTimeout(taskId string, timeout time.Duration) error {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	for _, task := range tm.Tasks {
+		if task.Id != taskId {
+			continue
 		}
-		task.Status = TransCancel
-		tm.popTask(taskId)
-		return nil
+		task.Timeout = timeout
+		return tm.Store.Update(task)
 	}
 	return util.NewError("%v", TransNotFound)
 }
 
-func (tm *TransManage) Process(id []string) {
-
+// SetTaskDeadline sets an absolute cutoff for taskId's Exec. Has no effect
+// once the task is already running, and is ignored if the task also has a
+// Timeout set.
+func SetTaskDeadline(taskId string, deadline time.Time) error {
+	return DefaultTransManager.SetTaskDeadline(taskId, deadline)
 }
 
-func (tm *TransManage) CallBack(call Call) error {
-	if "" == tm.Address {
-		log.W("CallBack will return because of empty address")
-		return nil
-	}
+func (tm *TransManage) SetTaskDeadline(taskId string, deadline time.Time) error {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
 
-	for i := 0; i < tm.TryTimes; i++ {
-		resp, err := http.Post(tm.Address, "application/json", strings.NewReader(util.S2Json(call)))
-		if err != nil {
-			log.W("CallBack with retryTime: %v, address: %v, call: %v error: %v", i, tm.Address, util.S2Json(call), err)
-			duration := time.Duration(rand.Intn(10)+10) * time.Second
-			time.Sleep(duration)
+	for _, task := range tm.Tasks {
+		if task.Id != taskId {
 			continue
 		}
-		if http.StatusOK != resp.StatusCode {
-			log.W("CallBack with retryTime: %v, address: %v, call: %v code: %v", i, tm.Address, util.S2Json(call), resp.StatusCode)
-			duration := time.Duration(rand.Intn(10)+10) * time.Second
-			time.Sleep(duration)
+		task.Deadline = deadline
+		return tm.Store.Update(task)
+	}
+	return util.NewError("%v", TransNotFound)
+}
+
+// Cancel the transcoding process by taskId. If the task is already running,
+// its Exec context is cancelled so the plugin can stop its own subprocess;
+// there's no separate plugin-level cancel call to race against it.
+// It will return error TransNotFound if can't find task.
+// todo. If exec Callback here?
+func (tm *TransManage) Cancel(taskId string) error {
+	tm.lock.Lock()
+
+	for _, task := range tm.Tasks {
+		if task.Id != taskId {
 			continue
 		}
-		log.W("CallBack with retryTime: %v, address: %v, call: %v success", i, tm.Address, util.S2Json(call))
+
+		if cancel, ok := tm.cancels[taskId]; ok {
+			cancel()
+		}
+		var wg = tm.stopProgressLocked(taskId)
+		task.Status = TransCancel
+		if err := tm.Store.Update(task); err != nil {
+			log.E("Cancel error updating task %v in store: %v", taskId, err)
+		}
+		tm.popTask(taskId)
+		tm.lock.Unlock()
+
+		// Wait for any in-flight progress sample to finish before
+		// returning, so it can't go on to write task.Progress or
+		// resurrect the just-popped task in the store after we're done.
+		if wg != nil {
+			wg.Wait()
+		}
 		return nil
 	}
-	return util.NewError("%v", TransTooManyTimes)
+	tm.lock.Unlock()
+	return util.NewError("%v", TransNotFound)
 }
+
+func (tm *TransManage) Process(id []string) {
+
+}
+